@@ -0,0 +1,21 @@
+package main
+
+import "io/fs"
+
+// layeredFS tries Override first for every Open call, falling back to Fallback when the
+// file isn't there. This lets an operator-supplied --assets directory take precedence over
+// the embedded res/ tree without needing to ship a full copy of it.
+type layeredFS struct {
+	Override fs.FS
+	Fallback fs.FS
+}
+
+// Open implements fs.FS.
+func (l layeredFS) Open(name string) (fs.File, error) {
+	if l.Override != nil {
+		if f, err := l.Override.Open(name); err == nil {
+			return f, nil
+		}
+	}
+	return l.Fallback.Open(name)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// CacheConfig configures the on-disk render cache.
+type CacheConfig struct {
+	Dir           string
+	MaxAge        time.Duration
+	MaxSize       int64
+	CleanInterval time.Duration
+}
+
+// DefaultCacheConfig returns the cache configuration, reading overrides from the
+// CACHE_DIR, CACHE_MAX_AGE, CACHE_MAX_SIZE and CACHE_CLEAN_INTERVAL environment
+// variables and falling back to sane defaults for anything left unset.
+func DefaultCacheConfig() CacheConfig {
+	cfg := CacheConfig{
+		Dir:           cacheDir,
+		MaxAge:        7 * 24 * time.Hour,
+		MaxSize:       256 << 20, // 256MiB
+		CleanInterval: 10 * time.Minute,
+	}
+
+	if dir := os.Getenv("CACHE_DIR"); dir != "" {
+		cfg.Dir = dir
+	}
+	if maxAge := os.Getenv("CACHE_MAX_AGE"); maxAge != "" {
+		if parsed, err := time.ParseDuration(maxAge); err == nil {
+			cfg.MaxAge = parsed
+		}
+	}
+	if maxSize := os.Getenv("CACHE_MAX_SIZE"); maxSize != "" {
+		if parsed, err := strconv.ParseInt(maxSize, 10, 64); err == nil {
+			cfg.MaxSize = parsed
+		}
+	}
+	if cleanInterval := os.Getenv("CACHE_CLEAN_INTERVAL"); cleanInterval != "" {
+		if parsed, err := time.ParseDuration(cleanInterval); err == nil {
+			cfg.CleanInterval = parsed
+		}
+	}
+
+	return cfg
+}
+
+// FileCache is a bounded on-disk cache of rendered portal images. Entries are keyed on
+// every parameter that affects the rendered bytes, so differently sized, colored, or
+// formatted variants of the same address coexist instead of clobbering one another.
+type FileCache struct {
+	cfg   CacheConfig
+	group singleflight.Group
+}
+
+// NewFileCache creates a FileCache rooted at cfg.Dir and starts its background janitor,
+// which evicts expired and excess-size entries every cfg.CleanInterval.
+func NewFileCache(cfg CacheConfig) (*FileCache, error) {
+	if err := os.MkdirAll(cfg.Dir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("creating cache directory: %w", err)
+	}
+
+	fc := &FileCache{cfg: cfg}
+	go fc.janitor()
+	return fc, nil
+}
+
+// Key hashes every parameter that affects the rendered bytes of address under opts into a
+// single cache key. This must cover every PortalOptions/GIFOptions field renderPortalBytes
+// consumes, or requests differing only in an unhashed field will collide on whichever one
+// rendered first.
+func Key(address string, opts PortalOptions) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s|%s|%d|%d|%.4f|%v|%v|%d|%.2f|%s|%d|%d|%d",
+		address, opts.Format, opts.Width, opts.Height, opts.Scale, opts.GlyphColor, opts.BgColor,
+		opts.BorderWidth, opts.FontSize, opts.FontPath, opts.GIF.FrameDelay, opts.GIF.FinalHold, opts.GIF.LoopCount)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// path returns the on-disk path for the given cache key and format.
+func (fc *FileCache) path(key, format string) string {
+	return filepath.Join(fc.cfg.Dir, fmt.Sprintf("%s.%s", key, format))
+}
+
+// GetOrRender returns the cached bytes for key if present. Otherwise it calls render once,
+// coalescing concurrent callers for the same key via singleflight so a thundering herd of
+// requests for the same uncached address only triggers a single render, caches the
+// already-encoded result, and returns it.
+func (fc *FileCache) GetOrRender(key, format string, render func() ([]byte, error)) ([]byte, error) {
+	path := fc.path(key, format)
+
+	if data, err := os.ReadFile(path); err == nil {
+		// Bump the file's mtime on every hit so clean()'s modTime-ordered eviction evicts the
+		// least recently *used* entry rather than the oldest one ever rendered.
+		now := time.Now()
+		os.Chtimes(path, now, now)
+		return data, nil
+	}
+
+	data, err, _ := fc.group.Do(key, func() (interface{}, error) {
+		data, err := render()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := os.WriteFile(path, data, os.ModePerm); err != nil {
+			return nil, fmt.Errorf("writing cache file: %w", err)
+		}
+
+		return data, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return data.([]byte), nil
+}
+
+// janitor periodically evicts cache entries older than MaxAge, then trims the oldest
+// remaining entries until the cache is back under MaxSize.
+func (fc *FileCache) janitor() {
+	ticker := time.NewTicker(fc.cfg.CleanInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		fc.clean()
+	}
+}
+
+// clean runs a single eviction pass over the cache directory, trimming the least recently
+// used entries first (GetOrRender touches an entry's mtime on every hit).
+func (fc *FileCache) clean() {
+	entries, err := os.ReadDir(fc.cfg.Dir)
+	if err != nil {
+		return
+	}
+
+	type fileInfo struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+
+	now := time.Now()
+	var files []fileInfo
+	var total int64
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		path := filepath.Join(fc.cfg.Dir, entry.Name())
+		if fc.cfg.MaxAge > 0 && now.Sub(info.ModTime()) > fc.cfg.MaxAge {
+			os.Remove(path)
+			continue
+		}
+
+		files = append(files, fileInfo{path, info.Size(), info.ModTime()})
+		total += info.Size()
+	}
+
+	if fc.cfg.MaxSize <= 0 || total <= fc.cfg.MaxSize {
+		return
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	for _, f := range files {
+		if total <= fc.cfg.MaxSize {
+			break
+		}
+		if err := os.Remove(f.path); err == nil {
+			total -= f.size
+		}
+	}
+}
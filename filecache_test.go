@@ -0,0 +1,145 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestKeyDeterministic(t *testing.T) {
+	opts := DefaultPortalOptions()
+
+	if Key("ADDR", opts) != Key("ADDR", opts) {
+		t.Fatal("Key is not deterministic for identical inputs")
+	}
+}
+
+// TestKeyDiffersPerField asserts that Key changes when any single field that
+// renderPortalBytes actually consumes changes, so distinct renders never share a cache file.
+func TestKeyDiffersPerField(t *testing.T) {
+	base := DefaultPortalOptions()
+	baseKey := Key("ADDR", base)
+
+	mutations := map[string]func(PortalOptions) PortalOptions{
+		"Format": func(o PortalOptions) PortalOptions { o.Format = "gif"; return o },
+		"Width":  func(o PortalOptions) PortalOptions { o.Width = o.Width + 1; return o },
+		"Height": func(o PortalOptions) PortalOptions { o.Height = o.Height + 1; return o },
+		"Scale":  func(o PortalOptions) PortalOptions { o.Scale = o.Scale + 1; return o },
+		"GlyphColor": func(o PortalOptions) PortalOptions {
+			o.GlyphColor.R++
+			return o
+		},
+		"BgColor": func(o PortalOptions) PortalOptions {
+			o.BgColor.R++
+			return o
+		},
+		"BorderWidth": func(o PortalOptions) PortalOptions { o.BorderWidth++; return o },
+		"FontSize":    func(o PortalOptions) PortalOptions { o.FontSize++; return o },
+		"FontPath":    func(o PortalOptions) PortalOptions { o.FontPath = "alt.ttf"; return o },
+		"GIF.FrameDelay": func(o PortalOptions) PortalOptions {
+			o.GIF.FrameDelay++
+			return o
+		},
+		"GIF.FinalHold": func(o PortalOptions) PortalOptions {
+			o.GIF.FinalHold++
+			return o
+		},
+		"GIF.LoopCount": func(o PortalOptions) PortalOptions {
+			o.GIF.LoopCount++
+			return o
+		},
+	}
+
+	for name, mutate := range mutations {
+		if key := Key("ADDR", mutate(base)); key == baseKey {
+			t.Errorf("changing %s did not change the cache key - collides with the unmutated render", name)
+		}
+	}
+}
+
+func TestCleanEvictsOldestFirstOverMaxSize(t *testing.T) {
+	dir := t.TempDir()
+	fc := &FileCache{cfg: CacheConfig{Dir: dir, MaxSize: 15}}
+
+	writeAged(t, dir, "oldest.png", 10, time.Now().Add(-2*time.Hour))
+	writeAged(t, dir, "middle.png", 10, time.Now().Add(-1*time.Hour))
+	writeAged(t, dir, "newest.png", 10, time.Now())
+
+	fc.clean()
+
+	assertExists(t, dir, "oldest.png", false)
+	assertExists(t, dir, "middle.png", false)
+	assertExists(t, dir, "newest.png", true)
+}
+
+func TestCleanRemovesExpiredByMaxAge(t *testing.T) {
+	dir := t.TempDir()
+	fc := &FileCache{cfg: CacheConfig{Dir: dir, MaxAge: time.Hour}}
+
+	writeAged(t, dir, "expired.png", 10, time.Now().Add(-2*time.Hour))
+	writeAged(t, dir, "fresh.png", 10, time.Now())
+
+	fc.clean()
+
+	assertExists(t, dir, "expired.png", false)
+	assertExists(t, dir, "fresh.png", true)
+}
+
+// TestCleanMeasuresAgeFromLastHit documents the consequence of f5e19eb's mtime-touch-on-hit:
+// GetOrRender bumps an entry's mtime on every hit, so MaxAge eviction is now measured from
+// last access rather than from creation - a popular, recently-served entry survives well past
+// MaxAge counted from when it was first rendered.
+func TestCleanMeasuresAgeFromLastHit(t *testing.T) {
+	dir := t.TempDir()
+	fc := &FileCache{cfg: CacheConfig{Dir: dir, MaxAge: time.Hour}}
+
+	key := "popular-address"
+	calls := 0
+	render := func() ([]byte, error) {
+		calls++
+		return []byte("data"), nil
+	}
+
+	if _, err := fc.GetOrRender(key, "png", render); err != nil {
+		t.Fatalf("initial render: %v", err)
+	}
+
+	// Back-date the file past MaxAge, as if it had been created long ago, then "hit" it -
+	// GetOrRender should serve the cached bytes and bump mtime rather than re-rendering.
+	path := fc.path(key, "png")
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatalf("backdating cache file: %v", err)
+	}
+
+	if _, err := fc.GetOrRender(key, "png", render); err != nil {
+		t.Fatalf("cache hit: %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected the cache hit to avoid re-rendering, render was called %d times", calls)
+	}
+
+	fc.clean()
+	assertExists(t, dir, key+".png", true)
+}
+
+func writeAged(t *testing.T, dir, name string, size int, mtime time.Time) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, make([]byte, size), os.ModePerm); err != nil {
+		t.Fatalf("writing %s: %v", name, err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatalf("setting mtime on %s: %v", name, err)
+	}
+}
+
+func assertExists(t *testing.T, dir, name string, want bool) {
+	t.Helper()
+	_, err := os.Stat(filepath.Join(dir, name))
+	got := err == nil
+	if got != want {
+		t.Errorf("%s exists = %v, want %v", name, got, want)
+	}
+}
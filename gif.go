@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"net/http"
+	"strconv"
+)
+
+// GIFOptions configures the animated "dialing" GIF variant of a portal image.
+type GIFOptions struct {
+	FrameDelay int // centiseconds shown per revealed glyph
+	FinalHold  int // centiseconds the fully-dialed frame is held for
+	LoopCount  int // gif.GIF LoopCount; 0 loops forever
+}
+
+// DefaultGIFOptions returns the GIF animation defaults.
+func DefaultGIFOptions() GIFOptions {
+	return GIFOptions{
+		FrameDelay: 50,
+		FinalHold:  300,
+		LoopCount:  0,
+	}
+}
+
+// maxGIFDelay bounds frame_delay/hold (in centiseconds) so a query param can't encode a
+// value that truncates or wraps when gif.GIF.Delay writes it into a uint16 on encode.
+const maxGIFDelay = 6000 // one minute per frame is already absurd
+
+// ValidateGIFOptions reports whether opts is encodable by image/gif: FrameDelay and
+// FinalHold must be positive centisecond counts no larger than maxGIFDelay, and LoopCount
+// must not be negative.
+func ValidateGIFOptions(opts GIFOptions) error {
+	if opts.FrameDelay <= 0 || opts.FrameDelay > maxGIFDelay {
+		return fmt.Errorf("frame_delay must be between 1 and %d, got %d", maxGIFDelay, opts.FrameDelay)
+	}
+	if opts.FinalHold <= 0 || opts.FinalHold > maxGIFDelay {
+		return fmt.Errorf("hold must be between 1 and %d, got %d", maxGIFDelay, opts.FinalHold)
+	}
+	if opts.LoopCount < 0 {
+		return fmt.Errorf("loop must not be negative, got %d", opts.LoopCount)
+	}
+	return nil
+}
+
+// applyGIFQueryParams reads frame_delay, hold, and loop query params onto opts.GIF,
+// leaving defaults in place for anything unset, and validates the result.
+func applyGIFQueryParams(opts *PortalOptions, r *http.Request) error {
+	if delay := r.URL.Query().Get("frame_delay"); delay != "" {
+		parsed, err := strconv.Atoi(delay)
+		if err != nil {
+			return fmt.Errorf("parsing frame_delay: %w", err)
+		}
+		opts.GIF.FrameDelay = parsed
+	}
+
+	if hold := r.URL.Query().Get("hold"); hold != "" {
+		parsed, err := strconv.Atoi(hold)
+		if err != nil {
+			return fmt.Errorf("parsing hold: %w", err)
+		}
+		opts.GIF.FinalHold = parsed
+	}
+
+	if loop := r.URL.Query().Get("loop"); loop != "" {
+		parsed, err := strconv.Atoi(loop)
+		if err != nil {
+			return fmt.Errorf("parsing loop: %w", err)
+		}
+		opts.GIF.LoopCount = parsed
+	}
+
+	return ValidateGIFOptions(opts.GIF)
+}
+
+// CreatePortalGIF renders an animated GIF that reveals address one glyph at a time, then
+// holds on the fully-dialed frame, mimicking the in-game portal dialing sequence.
+func (rn *Renderer) CreatePortalGIF(address string, opts PortalOptions) (*gif.GIF, error) {
+	f, err := rn.fontFor(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	palette := color.Palette{opts.BgColor, opts.GlyphColor}
+	anim := &gif.GIF{LoopCount: opts.GIF.LoopCount}
+
+	for n := 1; n <= len(address); n++ {
+		frame := CreateBlank(opts)
+		c := rn.PrepareFreetypeContext(frame, f, opts)
+		err := rn.DrawText(c, address[:n], opts)
+		rn.ReleaseContext(c)
+		if err != nil {
+			return nil, err
+		}
+
+		scaled := ResizeForScale(frame, opts)
+		paletted := image.NewPaletted(scaled.Bounds(), palette)
+		draw.Draw(paletted, paletted.Bounds(), scaled, image.Point{}, draw.Src)
+
+		anim.Image = append(anim.Image, paletted)
+		anim.Delay = append(anim.Delay, opts.GIF.FrameDelay)
+		anim.Disposal = append(anim.Disposal, gif.DisposalNone)
+	}
+
+	if len(anim.Image) > 0 {
+		anim.Image = append(anim.Image, anim.Image[len(anim.Image)-1])
+		anim.Delay = append(anim.Delay, opts.GIF.FinalHold)
+		anim.Disposal = append(anim.Disposal, gif.DisposalNone)
+	}
+
+	return anim, nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"github.com/chai2010/webp"
+	"github.com/golang/freetype"
+	"github.com/golang/freetype/truetype"
+	"github.com/nfnt/resize"
+)
+
+// PortalOptions configures a single portal image render, replacing the fixed
+// package constants so callers can request alternate sizes, colors, and
+// output formats per request.
+type PortalOptions struct {
+	Width       int
+	Height      int
+	Scale       float64
+	Format      string
+	GlyphColor  color.RGBA
+	BgColor     color.RGBA
+	BorderWidth int
+	FontSize    float64
+	DPI         float64
+	FontPath    string // alternate font file, relative to the assets dir; empty uses the default font
+	GIF         GIFOptions
+}
+
+// DefaultPortalOptions returns the options matching the module's original
+// fixed-size renderer, so callers that don't care about the new knobs get the
+// same output as before.
+func DefaultPortalOptions() PortalOptions {
+	return PortalOptions{
+		Width:       imgWidth,
+		Height:      imgHeight,
+		Scale:       1,
+		Format:      "png",
+		GlyphColor:  glyphColor,
+		BgColor:     bgColor,
+		BorderWidth: borderWidth,
+		FontSize:    fontSize,
+		DPI:         fontDpi,
+		GIF:         DefaultGIFOptions(),
+	}
+}
+
+// ReadFont reads font at the given path
+func ReadFont(fontPath string) (*truetype.Font, error) {
+
+	fontBytes, err := res.ReadFile(fontPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading font: %w", err)
+	}
+
+	f, err := freetype.ParseFont(fontBytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing font: %w", err)
+	}
+
+	return f, nil
+
+}
+
+// createBlank creates the blank image to draw the glyphs on
+func CreateBlank(opts PortalOptions) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, opts.Width, opts.Height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(opts.BgColor), image.Point{}, draw.Src)
+
+	if opts.BorderWidth <= 0 {
+		return img
+	}
+
+	for x := 0; x < opts.Width; x++ {
+		for y := 0; y < opts.Height; y++ {
+			switch {
+			case x < opts.BorderWidth:
+				img.Set(x, y, opts.GlyphColor)
+			case x >= opts.Width-opts.BorderWidth:
+				img.Set(x, y, opts.GlyphColor)
+			case y < opts.BorderWidth:
+				img.Set(x, y, opts.GlyphColor)
+			case y >= opts.Height-opts.BorderWidth:
+				img.Set(x, y, opts.GlyphColor)
+			}
+		}
+	}
+	return img
+}
+
+// maxScale bounds the "scale" query param, so a huge value can't be used to force an
+// enormous allocation in ResizeForScale.
+const maxScale = 8
+
+// ValidateScale reports whether scale is a usable resize factor: strictly positive and no
+// larger than maxScale.
+func ValidateScale(scale float64) error {
+	if scale <= 0 {
+		return fmt.Errorf("scale must be positive, got %v", scale)
+	}
+	if scale > maxScale {
+		return fmt.Errorf("scale must be at most %v, got %v", maxScale, scale)
+	}
+	return nil
+}
+
+// ResizeForScale scales img by opts.Scale (when not 1) using a high-quality resampling
+// filter, so retina/HiDPI variants don't require re-rasterizing the font at a larger size.
+func ResizeForScale(img image.Image, opts PortalOptions) image.Image {
+	if opts.Scale == 0 || opts.Scale == 1 {
+		return img
+	}
+
+	width := uint(float64(opts.Width) * opts.Scale)
+	height := uint(float64(opts.Height) * opts.Scale)
+	return resize.Resize(width, height, img, resize.Lanczos3)
+}
+
+// EncodeImage writes img to w in the given format. Supported formats are "png", "jpeg"/"jpg",
+// and "webp"; an empty format defaults to PNG. "gif" is handled separately by
+// renderPortalBytes, which always produces the animated portal-dialing sequence instead of a
+// single static frame.
+func EncodeImage(w io.Writer, img image.Image, format string) error {
+	switch format {
+	case "", "png":
+		return png.Encode(w, img)
+	case "jpeg", "jpg":
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: 90})
+	case "webp":
+		return webp.Encode(w, img, &webp.Options{Quality: 90})
+	default:
+		return fmt.Errorf("unsupported format: %q", format)
+	}
+}
+
+// ValidateFormat reports whether format is one EncodeImage (or the animated GIF path) can produce.
+func ValidateFormat(format string) error {
+	switch format {
+	case "", "png", "jpeg", "jpg", "gif", "webp":
+		return nil
+	default:
+		return fmt.Errorf("unsupported format: %q", format)
+	}
+}
+
+// ContentTypeFor returns the MIME type to serve for the given format.
+func ContentTypeFor(format string) string {
+	switch format {
+	case "jpeg", "jpg":
+		return "image/jpeg"
+	case "gif":
+		return "image/gif"
+	case "webp":
+		return "image/webp"
+	default:
+		return "image/png"
+	}
+}
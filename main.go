@@ -1,23 +1,20 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
 	"embed"
-	"errors"
+	"flag"
 	"fmt"
-	"image"
 	"image/color"
-	"image/draw"
-	"image/png"
-	"io"
+	"image/gif"
 	"io/fs"
 	"net/http"
+	"strconv"
+	"time"
 
 	"os"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/golang/freetype"
-	"github.com/golang/freetype/truetype"
 	"golang.org/x/image/font"
 )
 
@@ -38,204 +35,208 @@ var (
 )
 
 var (
-	glyphColor    = color.RGBA{0x00, 0xB0, 0xBD, 0xFF}
-	bgColor       = color.RGBA{0x00, 0x00, 0x00, 0x2C}
-	bgColorImg    = image.NewUniform(bgColor)
-	glyphColorImg = image.NewUniform(glyphColor)
+	glyphColor = color.RGBA{0x00, 0xB0, 0xBD, 0xFF}
+	bgColor    = color.RGBA{0x00, 0x00, 0x00, 0x2C}
 )
 
-// ReadFont reads font at the given path
-func ReadFont(fontPath string) (*truetype.Font, error) {
+// optionsFromRequest builds a PortalOptions from the route's format suffix and the request's
+// query parameters, starting from rn's current config and the named theme (if any) for
+// anything neither the route nor the query string sets.
+func optionsFromRequest(r *http.Request, rn *Renderer, themes *ThemeRegistry) (PortalOptions, error) {
+	opts := rn.Config()
 
-	fontBytes, err := res.ReadFile(fontPath)
-	if err != nil {
-		return nil, fmt.Errorf("reading font: %w", err)
+	if name := r.URL.Query().Get("theme"); name != "" {
+		if theme, ok := themes.Get(name); ok {
+			opts = theme.Apply(opts)
+		}
 	}
 
-	f, err := freetype.ParseFont(fontBytes)
-	if err != nil {
-		return nil, fmt.Errorf("parsing font: %w", err)
+	if ext := chi.URLParam(r, "ext"); ext != "" {
+		opts.Format = ext
+	}
+	if fmtParam := r.URL.Query().Get("fmt"); fmtParam != "" {
+		opts.Format = fmtParam
+	}
+	if err := ValidateFormat(opts.Format); err != nil {
+		return opts, err
 	}
 
-	return f, nil
+	if scale := r.URL.Query().Get("scale"); scale != "" {
+		parsed, err := strconv.ParseFloat(scale, 64)
+		if err != nil {
+			return opts, fmt.Errorf("parsing scale: %w", err)
+		}
+		if err := ValidateScale(parsed); err != nil {
+			return opts, err
+		}
+		opts.Scale = parsed
+	}
 
-}
+	if fg := r.URL.Query().Get("fg"); fg != "" {
+		parsed, err := parseHexColor(fg)
+		if err != nil {
+			return opts, fmt.Errorf("parsing fg: %w", err)
+		}
+		opts.GlyphColor = parsed
+	}
 
-// createBlank creates the blank image to draw the glyphs on
-func CreateBlank() *image.RGBA {
-	img := image.NewRGBA(image.Rect(0, 0, imgWidth, imgHeight))
-	draw.Draw(img, img.Bounds(), bgColorImg, image.Point{}, draw.Src)
-
-	if borderWidth <= 0 {
-		return img
-	}
-
-	for x := 0; x < imgWidth; x++ {
-		for y := 0; y < imgHeight; y++ {
-			switch {
-			case x < borderWidth:
-				img.Set(x, y, glyphColor)
-			case x >= imgWidth-borderWidth:
-				img.Set(x, y, glyphColor)
-			case y < borderWidth:
-				img.Set(x, y, glyphColor)
-			case y >= imgHeight-borderWidth:
-				img.Set(x, y, glyphColor)
-			}
+	if bg := r.URL.Query().Get("bg"); bg != "" {
+		parsed, err := parseHexColor(bg)
+		if err != nil {
+			return opts, fmt.Errorf("parsing bg: %w", err)
 		}
+		opts.BgColor = parsed
 	}
-	return img
-}
 
-// PrepareFreetypeContext sets up all the bits and bobs related to drawing text on the image
-func PrepareFreetypeContext(dst *image.RGBA, font *truetype.Font) *freetype.Context {
-	c := freetype.NewContext()
-	c.SetDPI(fontDpi)
-	c.SetFont(font)
-	c.SetHinting(fontHinting)
-	c.SetFontSize(fontSize)
-	c.SetSrc(glyphColorImg)
-	c.SetDst(dst)
-	c.SetClip(dst.Bounds())
-
-	return c
+	if err := applyGIFQueryParams(&opts, r); err != nil {
+		return opts, err
+	}
+
+	return opts, nil
 }
 
-// DrawText draws the given text in the given context
-func DrawText(c *freetype.Context, text string) error {
-	baseline := (int(c.PointToFixed(fontSize) >> 6))
-	pt := freetype.Pt(0, baseline-10)
-	_, err := c.DrawString(text, pt)
+// parseHexColor parses a 6-digit RGB hex string (no leading '#') into an opaque color.RGBA.
+func parseHexColor(s string) (color.RGBA, error) {
+	var r, g, b uint8
+	_, err := fmt.Sscanf(s, "%02x%02x%02x", &r, &g, &b)
 	if err != nil {
-		return fmt.Errorf("drawing text: %w", err)
+		return color.RGBA{}, fmt.Errorf("expected 6 hex digits, got %q: %w", s, err)
 	}
-	return nil
+	return color.RGBA{r, g, b, 0xFF}, nil
 }
 
-// SaveToCache writes the given image to a file named after the given addresss
-func SaveToCache(img *image.RGBA, address string) error {
-
-	_, err := os.Stat(cacheDir)
-	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			err = os.Mkdir(cacheDir, os.ModePerm)
-			if err != nil {
-				return fmt.Errorf("creating cache directory: %w", err)
-			}
-		} else {
-			return fmt.Errorf("accessing cache directory: %w", err)
+// renderPortalBytes renders address under opts using rn and encodes it to its final
+// on-the-wire bytes. A "gif" format always produces the animated glyph-reveal sequence
+// rather than a static frame.
+func renderPortalBytes(rn *Renderer, address string, opts PortalOptions) ([]byte, error) {
+	if opts.Format == "gif" {
+		anim, err := rn.CreatePortalGIF(address, opts)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := gif.EncodeAll(&buf, anim); err != nil {
+			return nil, fmt.Errorf("encoding gif: %w", err)
 		}
+		return buf.Bytes(), nil
 	}
 
-	outfile, err := os.Create(fmt.Sprintf("%s/%s.png", cacheDir, address))
+	img, err := rn.CreatePortalImage(address, opts)
 	if err != nil {
-		return fmt.Errorf("creating image file: %w", err)
+		return nil, err
 	}
-	defer outfile.Close()
 
-	buf := bufio.NewWriter(outfile)
-	err = png.Encode(buf, img)
-	if err != nil {
-		return fmt.Errorf("encoding image: %w", err)
-	}
-	err = buf.Flush()
-	if err != nil {
-		return fmt.Errorf("flushing image to disk: %w", err)
+	var buf bytes.Buffer
+	if err := EncodeImage(&buf, img, opts.Format); err != nil {
+		return nil, fmt.Errorf("encoding image: %w", err)
 	}
-
-	return nil
+	return buf.Bytes(), nil
 }
 
-// CreatePortalImage creates an image with the given portal address on it
-func CreatePortalImage(address string) (*image.RGBA, error) {
-	font, err := ReadFont(portalFont)
-	if err != nil {
-		return nil, err
-	}
+// WritePortalImage writes a portal address image of the given address to the given io.ResponseWriter,
+// rendered by rn according to opts. It also sets the Content-Type header to match opts.Format, and
+// will generate the image if it does not exist in the cache already.
+func WritePortalImage(w http.ResponseWriter, address string, opts PortalOptions, rn *Renderer, fc *FileCache) error {
 
-	img := CreateBlank()
+	w.Header().Set("Content-Type", ContentTypeFor(opts.Format))
 
-	c := PrepareFreetypeContext(img, font)
-
-	err = DrawText(c, address)
+	key := Key(address, opts)
+	data, err := fc.GetOrRender(key, opts.Format, func() ([]byte, error) {
+		return renderPortalBytes(rn, address, opts)
+	})
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("rendering image: %w", err)
 	}
 
-	err = SaveToCache(img, address)
-	if err != nil {
-		return nil, err
-	}
-	return img, nil
+	_, err = w.Write(data)
+	return err
 }
 
-// ServeFromCache copies the file of the given filename to the given io.Writer
-func ServeFromCache(w io.Writer, filename string) error {
-	file, err := os.Open(filename)
-	if err != nil {
-		return fmt.Errorf("cache open: %w", err)
+// watchDefaultConfig re-applies the "default" theme (themes/default.json in the assets dir,
+// if present) onto rn's base config every interval. This gives SetConfig a real caller: an
+// operator can retune rendering defaults - size, colors, font - by editing that file, with no
+// restart required, the same way any other theme hot-reloads.
+func watchDefaultConfig(rn *Renderer, themes *ThemeRegistry, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if theme, ok := themes.Get("default"); ok {
+			rn.SetConfig(theme.Apply(DefaultPortalOptions()))
+		}
 	}
-	defer file.Close()
+}
 
-	_, err = io.Copy(w, file)
-	return err
+// RouteAddress builds an http.HandlerFunc that gets the address and output format from Chi and
+// asks rn to serve an image showing that address, caching the result via fc. Handlers get their
+// dependencies through this closure instead of package-level globals.
+func RouteAddress(rn *Renderer, fc *FileCache, themes *ThemeRegistry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		address := chi.URLParam(r, "address")
+		opts, err := optionsFromRequest(r, rn, themes)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = WritePortalImage(w, address, opts, rn, fc)
+		if err != nil {
+			fmt.Printf("ERROR encountered while trying to serve %s: %s\n", address, err)
+		}
+	}
 }
 
-// WritePortalImage writes a portal address image of the given address to the given io.ResponseWriter.
-// It also sets the Content-Type header to "img/png" in the process, and will generate the image if it
-// does not exist in cache already.
-func WritePortalImage(w http.ResponseWriter, address string) error {
+func main() {
 
-	w.Header().Set("Content-Type", "image/png")
+	assetsDir := flag.String("assets", "", "optional directory to serve and load themes from, overriding the embedded res/ tree")
+	flag.Parse()
 
-	filename := fmt.Sprintf("%s/%s.png", cacheDir, address)
-	if _, err := os.Stat(filename); err == nil { // That is, the cache file exists and is all good!
-		return ServeFromCache(w, filename)
+	embeddedAssets, err := fs.Sub(res, "res")
+	if err != nil {
+		panic(fmt.Sprintf("Unable to peer down embedded file tree: %s", err))
 	}
 
-	// If we got here, then it was not cached, and we need to create it.
-	img, err := CreatePortalImage(address)
-	if err != nil {
-		return fmt.Errorf("creating image: %w", err)
+	// SKIPEMBED is a legacy shorthand for --assets=res, kept for existing dev workflows.
+	override := *assetsDir
+	if override == "" && os.Getenv("SKIPEMBED") != "" {
+		override = "res"
+	}
+
+	var assets fs.FS = embeddedAssets
+	if override != "" {
+		fmt.Printf("Serving assets from %q, falling back to embedded files.\n", override)
+		assets = layeredFS{Override: os.DirFS(override), Fallback: embeddedAssets}
+	} else {
+		fmt.Println("Using embedded files for web interface.")
 	}
 
-	err = png.Encode(w, img) // FIXME: This does the encoding twice for uncached images!
+	renderer, err := NewRenderer(assets)
 	if err != nil {
-		return fmt.Errorf("encoding to output: %w", err)
+		panic(fmt.Sprintf("Unable to initialize renderer: %s", err))
+	}
+	if err := renderer.Warmup(nil); err != nil {
+		fmt.Printf("WARNING: renderer warmup failed: %s\n", err)
 	}
-	return nil
-}
 
-// RouteAddress simply gets the address from Chi and asks for a PNG showing that address.
-func RouteAddress(w http.ResponseWriter, r *http.Request) {
-	address := chi.URLParam(r, "address")
-	err := WritePortalImage(w, address)
+	cache, err := NewFileCache(DefaultCacheConfig())
 	if err != nil {
-		fmt.Printf("ERROR encountered while trying to serve %s: %s\n", address, err)
+		panic(fmt.Sprintf("Unable to set up image cache: %s", err))
 	}
-}
 
-func main() {
+	themes := NewThemeRegistry(override, 5*time.Second)
+	go watchDefaultConfig(renderer, themes, 5*time.Second)
 
 	router := chi.NewRouter()
-	router.Get("/{address:[0-9A-F]{16}}.png", RouteAddress)
-
-	// Set SKIPEMBED var to nonzero to simplify development of the client-side stuff.
-	// Otherwise, you'll need to recompile with every change to the HTML/CSS/JS...
-	enableEmbed := os.Getenv("SKIPEMBED") == ""
-	if enableEmbed {
-		fmt.Printf("Using embedded files for web interface.")
-		resHTML, err := fs.Sub(res, "res")
-		if err != nil {
-			panic(fmt.Sprintf("Unable to peer down embedded file tree: %s", err))
-		}
+	router.Get("/{address:[0-9A-F]{16}}.{ext:png|gif|jpe?g|webp}", RouteAddress(renderer, cache, themes))
+	router.Get("/oembed", RouteOEmbed(renderer))
 
-		fileServer := http.FileServer(http.FS(resHTML))
-		router.Handle("/*", fileServer)
+	if indexHandler, err := IndexHandler(assets); err == nil {
+		router.Get("/", indexHandler)
+		router.Get("/index.html", indexHandler)
 	} else {
-		fmt.Println("NOT using embedded files for web inteface")
-		router.Handle("/*", http.FileServer(http.Dir("res")))
+		fmt.Printf("WARNING: unable to prepare index page: %s\n", err)
 	}
+	router.Handle("/*", http.FileServer(http.FS(assets)))
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -243,7 +244,7 @@ func main() {
 	}
 
 	fmt.Printf("Listening on port %s\n", port)
-	err := http.ListenAndServe(fmt.Sprintf(":%s", port), router)
+	err = http.ListenAndServe(fmt.Sprintf(":%s", port), router)
 	if err != nil {
 		fmt.Printf("Shutting down: %s\n", err)
 	}
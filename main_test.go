@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestOptionsFromRequestUsesRendererConfig asserts that a request with no theme or query
+// overrides renders with rn's current config, so SetConfig actually reaches RouteAddress.
+func TestOptionsFromRequestUsesRendererConfig(t *testing.T) {
+	rn := &Renderer{config: DefaultPortalOptions()}
+	themes := NewThemeRegistry("", time.Hour)
+
+	want := DefaultPortalOptions()
+	want.FontSize = 99
+	rn.SetConfig(want)
+
+	req := httptest.NewRequest("GET", "/0000000000000000.png", nil)
+	got, err := optionsFromRequest(req, rn, themes)
+	if err != nil {
+		t.Fatalf("optionsFromRequest: %s", err)
+	}
+	if got.FontSize != want.FontSize {
+		t.Fatalf("FontSize = %v, want %v (SetConfig not reflected)", got.FontSize, want.FontSize)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// thumbnailScale is the scale factor used for the oEmbed response's optional thumbnail_url.
+const thumbnailScale = 0.25
+
+// addressPattern matches a bare 16-character portal glyph address.
+var addressPattern = regexp.MustCompile(`^[0-9A-F]{16}$`)
+
+// OEmbedResponse is the noembed-style JSON payload returned by the /oembed endpoint, letting
+// chat platforms that consume oEmbed unfurl portal address links inline.
+type OEmbedResponse struct {
+	Type         string `json:"type"`
+	Version      string `json:"version"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	URL          string `json:"url"`
+	Title        string `json:"title"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+}
+
+// addressFromURL extracts the 16-character portal address from a portal image URL's path,
+// e.g. "https://host/00112233445566AA.png" -> "00112233445566AA".
+func addressFromURL(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("parsing url: %w", err)
+	}
+
+	name := path.Base(u.Path)
+	address := strings.ToUpper(strings.TrimSuffix(name, path.Ext(name)))
+	if !addressPattern.MatchString(address) {
+		return "", fmt.Errorf("no portal address found in %q", rawURL)
+	}
+	return address, nil
+}
+
+// optionsFromURL builds a PortalOptions describing the specific portal variant rawURL points
+// at, starting from rn's base config and applying the same "fmt"/"scale" query parameters
+// optionsFromRequest applies to a live request, plus the format implied by rawURL's own file
+// extension.
+func optionsFromURL(rn *Renderer, rawURL string) (PortalOptions, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return PortalOptions{}, fmt.Errorf("parsing url: %w", err)
+	}
+
+	opts := rn.Config()
+
+	if ext := strings.TrimPrefix(path.Ext(u.Path), "."); ext != "" {
+		opts.Format = ext
+	}
+	if fmtParam := u.Query().Get("fmt"); fmtParam != "" {
+		opts.Format = fmtParam
+	}
+	if err := ValidateFormat(opts.Format); err != nil {
+		return opts, err
+	}
+
+	if scale := u.Query().Get("scale"); scale != "" {
+		parsed, err := strconv.ParseFloat(scale, 64)
+		if err != nil {
+			return opts, fmt.Errorf("parsing scale: %w", err)
+		}
+		if err := ValidateScale(parsed); err != nil {
+			return opts, err
+		}
+		opts.Scale = parsed
+	}
+
+	return opts, nil
+}
+
+// formatExtension returns the file extension for format, defaulting to "png" for the empty
+// format the same way EncodeImage and ContentTypeFor do.
+func formatExtension(format string) string {
+	if format == "" {
+		return "png"
+	}
+	return format
+}
+
+// RouteOEmbed builds an http.HandlerFunc implementing a noembed-style oEmbed provider for
+// portal addresses, so links to rendered portals unfurl inline on Discord, Slack, Mastodon,
+// and other oEmbed-consuming chat platforms.
+func RouteOEmbed(rn *Renderer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rawURL := r.URL.Query().Get("url")
+		if rawURL == "" {
+			http.Error(w, "missing url parameter", http.StatusBadRequest)
+			return
+		}
+
+		address, err := addressFromURL(rawURL)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		opts, err := optionsFromURL(rn, rawURL)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		width, height := opts.Width, opts.Height
+		if opts.Scale > 0 {
+			width = int(float64(width) * opts.Scale)
+			height = int(float64(height) * opts.Scale)
+		}
+
+		ext := formatExtension(opts.Format)
+		resp := OEmbedResponse{
+			Type:         "photo",
+			Version:      "1.0",
+			Width:        width,
+			Height:       height,
+			URL:          fmt.Sprintf("/%s.%s", address, ext),
+			Title:        address,
+			ThumbnailURL: fmt.Sprintf("/%s.%s?scale=%.2f", address, ext, thumbnailScale),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			fmt.Printf("ERROR encountered while trying to serve oembed for %s: %s\n", address, err)
+		}
+	}
+}
+
+// injectOpenGraphMeta inserts OpenGraph <meta> tags into html, just before its closing
+// </head> tag. The index page has no portal address of its own, so unlike a rendered portal
+// link it gets no oEmbed discovery <link> - addressFromURL can never resolve a URL pointing
+// back at the index page itself.
+func injectOpenGraphMeta(html []byte) []byte {
+	tags := []byte(`<meta property="og:type" content="website">
+<meta property="og:title" content="NMS Glyph Portal Address Renderer">
+<meta property="og:description" content="Render No Man's Sky portal glyph addresses as shareable images.">
+</head>`)
+
+	return bytes.Replace(html, []byte("</head>"), tags, 1)
+}
+
+// IndexHandler serves fsys's index.html with OpenGraph metadata injected, so links to the
+// tool itself get a nice preview card when shared.
+func IndexHandler(fsys fs.FS) (http.HandlerFunc, error) {
+	html, err := fs.ReadFile(fsys, "index.html")
+	if err != nil {
+		return nil, fmt.Errorf("reading index.html: %w", err)
+	}
+
+	html = injectOpenGraphMeta(html)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(html)
+	}, nil
+}
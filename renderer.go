@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"io/fs"
+	"sync"
+
+	"github.com/golang/freetype"
+	"github.com/golang/freetype/truetype"
+)
+
+// Renderer owns the parsed portal font and a pool of reusable freetype contexts, since
+// freetype.Context values are not safe for concurrent use. It also holds a hot-swappable
+// base config behind an RWMutex, so operators can retune defaults without a restart.
+type Renderer struct {
+	font   *truetype.Font
+	assets fs.FS
+	pool   sync.Pool // of *freetype.Context
+
+	mu     sync.RWMutex
+	config PortalOptions
+
+	fontCache sync.Map // opts.FontPath (string) -> *truetype.Font
+}
+
+// NewRenderer parses the embedded portal font once and returns a Renderer ready to serve
+// requests. assets is consulted for the alternate fonts a Theme may point FontPath at. Call
+// Warmup once at startup to pay the first-render cost before traffic arrives.
+func NewRenderer(assets fs.FS) (*Renderer, error) {
+	f, err := ReadFont(portalFont)
+	if err != nil {
+		return nil, err
+	}
+
+	rn := &Renderer{font: f, assets: assets, config: DefaultPortalOptions()}
+	rn.pool.New = func() interface{} {
+		return freetype.NewContext()
+	}
+	return rn, nil
+}
+
+// fontFor resolves the font to draw with: the renderer's default font, unless opts.FontPath
+// names an alternate font file in assets, in which case it is parsed once and cached.
+func (rn *Renderer) fontFor(opts PortalOptions) (*truetype.Font, error) {
+	if opts.FontPath == "" {
+		return rn.font, nil
+	}
+
+	if cached, ok := rn.fontCache.Load(opts.FontPath); ok {
+		return cached.(*truetype.Font), nil
+	}
+
+	fontBytes, err := fs.ReadFile(rn.assets, opts.FontPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading theme font %q: %w", opts.FontPath, err)
+	}
+
+	f, err := freetype.ParseFont(fontBytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing theme font %q: %w", opts.FontPath, err)
+	}
+
+	rn.fontCache.Store(opts.FontPath, f)
+	return f, nil
+}
+
+// Config returns the renderer's current base configuration.
+func (rn *Renderer) Config() PortalOptions {
+	rn.mu.RLock()
+	defer rn.mu.RUnlock()
+	return rn.config
+}
+
+// SetConfig hot-swaps the renderer's base configuration, taking effect for any request
+// handled after the call returns.
+func (rn *Renderer) SetConfig(opts PortalOptions) {
+	rn.mu.Lock()
+	defer rn.mu.Unlock()
+	rn.config = opts
+}
+
+// PrepareFreetypeContext borrows a pooled freetype.Context and configures it to draw onto
+// dst using f and opts. Callers must return it via ReleaseContext when done.
+func (rn *Renderer) PrepareFreetypeContext(dst *image.RGBA, f *truetype.Font, opts PortalOptions) *freetype.Context {
+	c := rn.pool.Get().(*freetype.Context)
+	c.SetDPI(opts.DPI)
+	c.SetFont(f)
+	c.SetHinting(fontHinting)
+	c.SetFontSize(opts.FontSize)
+	c.SetSrc(image.NewUniform(opts.GlyphColor))
+	c.SetDst(dst)
+	c.SetClip(dst.Bounds())
+
+	return c
+}
+
+// ReleaseContext returns a freetype.Context borrowed via PrepareFreetypeContext to the pool.
+func (rn *Renderer) ReleaseContext(c *freetype.Context) {
+	rn.pool.Put(c)
+}
+
+// DrawText draws the given text in the given context
+func (rn *Renderer) DrawText(c *freetype.Context, text string, opts PortalOptions) error {
+	baseline := int(c.PointToFixed(opts.FontSize) >> 6)
+	pt := freetype.Pt(0, baseline-10)
+	_, err := c.DrawString(text, pt)
+	if err != nil {
+		return fmt.Errorf("drawing text: %w", err)
+	}
+	return nil
+}
+
+// CreatePortalImage creates an image with the given portal address on it, rendered according to opts.
+func (rn *Renderer) CreatePortalImage(address string, opts PortalOptions) (image.Image, error) {
+	f, err := rn.fontFor(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	img := CreateBlank(opts)
+
+	c := rn.PrepareFreetypeContext(img, f, opts)
+	defer rn.ReleaseContext(c)
+
+	if err := rn.DrawText(c, address, opts); err != nil {
+		return nil, err
+	}
+
+	return ResizeForScale(img, opts), nil
+}
+
+// Warmup forces an initial parse+draw cycle, plus one per prefix, so the renderer's font
+// and context pool are already warm before the first real request arrives.
+func (rn *Renderer) Warmup(prefixes []string) error {
+	opts := rn.Config()
+
+	if _, err := rn.CreatePortalImage("0000000000000000", opts); err != nil {
+		return fmt.Errorf("warmup render: %w", err)
+	}
+
+	for _, prefix := range prefixes {
+		if _, err := rn.CreatePortalImage(prefix, opts); err != nil {
+			return fmt.Errorf("warmup render %q: %w", prefix, err)
+		}
+	}
+
+	return nil
+}
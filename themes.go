@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HexColor unmarshals a 6-digit RGB hex string (no leading '#') from theme JSON into a color.RGBA.
+type HexColor color.RGBA
+
+// UnmarshalJSON implements json.Unmarshaler for HexColor.
+func (h *HexColor) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	c, err := parseHexColor(s)
+	if err != nil {
+		return err
+	}
+
+	*h = HexColor(c)
+	return nil
+}
+
+// Theme overrides a subset of PortalOptions for a named variant, loaded from a
+// themes/<name>.json file in the assets directory. Fields left out of the JSON are left
+// untouched by Apply.
+type Theme struct {
+	GlyphColor  *HexColor `json:"glyphColor,omitempty"`
+	BgColor     *HexColor `json:"bgColor,omitempty"`
+	BorderWidth *int      `json:"borderWidth,omitempty"`
+	FontSize    *float64  `json:"fontSize,omitempty"`
+	FontPath    string    `json:"fontPath,omitempty"`
+}
+
+// Apply overlays the theme's set fields onto opts, leaving anything the theme doesn't
+// specify untouched.
+func (t Theme) Apply(opts PortalOptions) PortalOptions {
+	if t.GlyphColor != nil {
+		opts.GlyphColor = color.RGBA(*t.GlyphColor)
+	}
+	if t.BgColor != nil {
+		opts.BgColor = color.RGBA(*t.BgColor)
+	}
+	if t.BorderWidth != nil {
+		opts.BorderWidth = *t.BorderWidth
+	}
+	if t.FontSize != nil {
+		opts.FontSize = *t.FontSize
+	}
+	if t.FontPath != "" {
+		opts.FontPath = t.FontPath
+	}
+	return opts
+}
+
+// ThemeRegistry loads themes/<name>.json files from an assets directory and hot-reloads them
+// when a file's mtime changes, so operators can iterate on a theme without restarting. A
+// registry with an empty assetsDir is inert: Get always reports no match.
+type ThemeRegistry struct {
+	dir string
+
+	mu     sync.RWMutex
+	themes map[string]Theme
+	mtimes map[string]time.Time
+}
+
+// NewThemeRegistry creates a ThemeRegistry rooted at <assetsDir>/themes, loads whatever is
+// there already, and starts a debounced watcher polling every pollInterval for mtime changes.
+func NewThemeRegistry(assetsDir string, pollInterval time.Duration) *ThemeRegistry {
+	tr := &ThemeRegistry{
+		themes: make(map[string]Theme),
+		mtimes: make(map[string]time.Time),
+	}
+	if assetsDir == "" {
+		return tr
+	}
+
+	tr.dir = filepath.Join(assetsDir, "themes")
+	tr.reload()
+	go tr.watch(pollInterval)
+	return tr
+}
+
+// Get returns the named theme and whether it was found.
+func (tr *ThemeRegistry) Get(name string) (Theme, bool) {
+	tr.mu.RLock()
+	defer tr.mu.RUnlock()
+	t, ok := tr.themes[name]
+	return t, ok
+}
+
+// watch polls tr.dir on a ticker, reloading whenever an entry's mtime has moved.
+func (tr *ThemeRegistry) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if tr.changed() {
+			tr.reload()
+		}
+	}
+}
+
+// changed reports whether any themes/*.json file's mtime has moved since the last load.
+func (tr *ThemeRegistry) changed() bool {
+	entries, err := os.ReadDir(tr.dir)
+	if err != nil {
+		return false
+	}
+
+	tr.mu.RLock()
+	defer tr.mu.RUnlock()
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if !info.ModTime().Equal(tr.mtimes[entry.Name()]) {
+			return true
+		}
+	}
+	return false
+}
+
+// reload re-reads every themes/*.json file in tr.dir.
+func (tr *ThemeRegistry) reload() {
+	entries, err := os.ReadDir(tr.dir)
+	if err != nil {
+		return
+	}
+
+	themes := make(map[string]Theme)
+	mtimes := make(map[string]time.Time)
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		path := filepath.Join(tr.dir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		var theme Theme
+		if err := json.Unmarshal(data, &theme); err != nil {
+			fmt.Printf("WARNING: unable to parse theme %s: %s\n", path, err)
+			continue
+		}
+
+		name := strings.TrimSuffix(entry.Name(), ".json")
+		themes[name] = theme
+
+		if info, err := entry.Info(); err == nil {
+			mtimes[entry.Name()] = info.ModTime()
+		}
+	}
+
+	tr.mu.Lock()
+	tr.themes = themes
+	tr.mtimes = mtimes
+	tr.mu.Unlock()
+}